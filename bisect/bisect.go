@@ -0,0 +1,400 @@
+// Copyright (C) 2018 Michael J. Fromberger. All Rights Reserved.
+
+// Package bisect implements binary search over a range of integer probe
+// points to find where the status of a linear history changes between two
+// states (Good and Bad), in either direction.
+//
+// A Searcher drives the search by invoking a caller-supplied Probe at probe
+// points chosen to bisect the remaining interval, optionally bracketing an
+// unbounded endpoint before the search begins.
+package bisect
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Status reports the outcome of a probe.
+type Status int
+
+// Status markers.
+const (
+	Bad  Status = iota // the probe point exhibits the non-working behavior
+	Good               // the probe point exhibits the working behavior
+	Skip               // the probe point could not be tested
+)
+
+func (s Status) String() string {
+	switch s {
+	case Good:
+		return "GOOD"
+	case Skip:
+		return "SKIP"
+	default:
+		return "BAD"
+	}
+}
+
+// Mark returns a single-character glyph representing s, for use in
+// human-readable diagnostics.
+func (s Status) Mark() rune {
+	switch s {
+	case Good:
+		return '✓'
+	case Skip:
+		return '?'
+	default:
+		return '✗'
+	}
+}
+
+// Probe reports the status of the system at probe point n. The context may
+// be used to cancel a probe in progress. A Probe may return Skip to report
+// that n is untestable (for example, a revision that fails to build); the
+// Searcher will try nearby points instead of treating Skip as Bad.
+type Probe func(ctx context.Context, n int) (Status, error)
+
+// A Searcher drives a bisection search over a range of integer probe
+// points using a caller-supplied Probe.
+type Searcher struct {
+	// Probe reports the status at a given probe point. It must not be nil.
+	Probe Probe
+
+	// Verify, if true, checks that the starting endpoints have the status
+	// the caller expects before the search begins. When Bracket is true, an
+	// endpoint of 0 is not checked, since bracketing replaces it.
+	Verify bool
+
+	// Bracket, if true, permits the search to extend an endpoint of 0
+	// outward to find a bracketing value (see Search).
+	Bracket bool
+
+	// MaxBracket, if positive, bounds how far the bracketing search in
+	// Search may extend before it gives up.
+	MaxBracket int
+
+	// Parallel, if greater than 1, has Search speculatively probe up to
+	// Parallel points at once, spread across quantiles of the remaining
+	// interval, cancelling those that fall outside the interval as it
+	// narrows. This trades extra probes for reduced wall-clock time when
+	// probes are slow and roughly uniform in duration. A value of 0 or 1
+	// probes serially.
+	Parallel int
+
+	// Log, if set, receives diagnostic messages describing the progress of
+	// the search. If nil, no diagnostics are produced.
+	Log io.Writer
+}
+
+// Result reports the outcome of a completed search.
+type Result struct {
+	Lo, Hi     int    // the endpoints bracketing the culprit
+	LoOK, HiOK Status // the status of Lo and Hi, respectively
+	Probes     int    // the number of probes issued, not counting Verify probes
+	Elapsed    time.Duration
+
+	// Indeterminate is true if the search stopped before Lo and Hi were
+	// adjacent because every untested point between them reported Skip, so
+	// the region could not be narrowed further.
+	Indeterminate bool
+}
+
+// Found reports whether r identifies a culprit, meaning the endpoints are
+// adjacent and have different status.
+func (r *Result) Found() bool { return r.Lo+1 == r.Hi && r.LoOK != r.HiOK }
+
+func (s *Searcher) logf(msg string, args ...interface{}) {
+	if s.Log != nil {
+		fmt.Fprintf(s.Log, msg+"\n", args...)
+	}
+}
+
+// Search performs a binary search between good and bad, which must be
+// non-negative and distinct, to find the adjacent pair of probe points
+// where the status changes. At least one of good, bad must be positive; if
+// one is 0 and s.Bracket is true, Search first searches for a bracketing
+// value above the other endpoint.
+//
+// The ctx governs cancellation of in-flight probes; if ctx is cancelled,
+// Search returns ctx.Err().
+func (s *Searcher) Search(ctx context.Context, good, bad int) (*Result, error) {
+	if good < 0 || bad < 0 {
+		return nil, fmt.Errorf("good (%d) and bad (%d) must be non-negative", good, bad)
+	} else if good == bad {
+		return nil, fmt.Errorf("good and bad must be distinct (got %d)", good)
+	}
+	s.logf("Using %d as GOOD, using %d as BAD", good, bad)
+
+	lo, hi, loOK, hiOK := minmax(good, bad)
+	np := 0
+	start := time.Now()
+
+	if s.Verify {
+		if lo > 0 || !s.Bracket {
+			s.logf("▷ Verifying that %d is %v...", lo, loOK)
+			if ok, err := s.Probe(ctx, lo); err != nil {
+				return nil, err
+			} else if ok != loOK {
+				return nil, fmt.Errorf("value %d reports as %v, but is expected to be %v", lo, ok, loOK)
+			}
+		}
+		s.logf("▷ Verifying that %d is %v...", hi, hiOK)
+		if ok, err := s.Probe(ctx, hi); err != nil {
+			return nil, err
+		} else if ok != hiOK {
+			return nil, fmt.Errorf("value %d reports as %v, but is expected to be %v", hi, ok, hiOK)
+		}
+	}
+
+	if s.Bracket && lo == 0 {
+		var err error
+		lo, hi, loOK, hiOK, err = s.findBracket(ctx, hi, hiOK, &np)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if s.Parallel > 1 {
+		lo, hi, loOK, hiOK, indeterminate, err := s.searchParallel(ctx, lo, hi, loOK, hiOK, &np)
+		if err != nil {
+			return nil, err
+		}
+		return &Result{Lo: lo, Hi: hi, LoOK: loOK, HiOK: hiOK, Probes: np, Elapsed: time.Since(start), Indeterminate: indeterminate}, nil
+	}
+
+	for lo+1 < hi {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		next := (lo + hi) / 2
+		s.logf("Current state: lo=%d [%s] hi=%d [%s]; next=%d Δ=%d", lo, loOK, hi, hiOK, next, hi-lo)
+		cand, ok, found, err := s.probeNearby(ctx, lo, hi, next, &np)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			s.logf("Cannot narrow further: every point in (%d, %d) is SKIP", lo, hi)
+			return &Result{Lo: lo, Hi: hi, LoOK: loOK, HiOK: hiOK, Probes: np, Elapsed: time.Since(start), Indeterminate: true}, nil
+		}
+		if ok == loOK {
+			lo, loOK = cand, ok
+		} else {
+			hi, hiOK = cand, ok
+		}
+	}
+
+	return &Result{Lo: lo, Hi: hi, LoOK: loOK, HiOK: hiOK, Probes: np, Elapsed: time.Since(start)}, nil
+}
+
+// probeOutcome reports the result of one speculative probe launched by
+// searchParallel.
+type probeOutcome struct {
+	idx    int
+	status Status
+	err    error
+}
+
+// searchParallel narrows (lo, hi) using up to s.Parallel probes in flight at
+// once, spread across the quantiles of the remaining interval. It cancels
+// in-flight probes that fall outside the interval as it narrows. A point
+// that reports Skip is recorded so it is never relaunched, and is replaced
+// by a nearby untried point (as the serial probeNearby does); if every
+// point in the interval turns out to be Skip and the interval cannot be
+// narrowed further, it returns with indeterminate set.
+func (s *Searcher) searchParallel(ctx context.Context, lo, hi int, loOK, hiOK Status, np *int) (rlo, rhi int, rloOK, rhiOK Status, indeterminate bool, err error) {
+	// Buffered so a probe that finishes just as the loop below exits can
+	// still deliver its result (and thus its goroutine can exit) without a
+	// reader; searchParallel never has more than s.Parallel probes in
+	// flight at once.
+	results := make(chan probeOutcome, s.Parallel)
+	inflight := make(map[int]context.CancelFunc)
+	tried := make(map[int]bool) // indices already launched or found to be Skip
+
+	launch := func(idx int) {
+		tried[idx] = true
+		pctx, cancel := context.WithCancel(ctx)
+		inflight[idx] = cancel
+		*np++
+		go func() {
+			st, perr := s.Probe(pctx, idx)
+			if pctx.Err() != nil {
+				return // cancelled because the interval moved past idx; nothing to report
+			}
+			results <- probeOutcome{idx, st, perr}
+		}()
+	}
+
+	// nextUntried scans outward from center by ±1, ±2, … within the open
+	// interval (lo, hi) for a point that has not yet been tried. It reports
+	// found=false once every point in (lo, hi) has been tried.
+	nextUntried := func(center int) (cand int, found bool) {
+		for d := 1; ; d++ {
+			left, right := center-d, center+d
+			if left <= lo && right >= hi {
+				return 0, false
+			}
+			if right < hi && !tried[right] {
+				return right, true
+			}
+			if left > lo && !tried[left] {
+				return left, true
+			}
+		}
+	}
+
+	// refill launches probes at successive quantiles of (lo, hi) until
+	// s.Parallel are in flight or every quantile has been tried. If that
+	// leaves nothing in flight, it launches the untried point nearest the
+	// middle of (lo, hi), if any.
+	refill := func() {
+		for k := 1; k <= s.Parallel && len(inflight) < s.Parallel; k++ {
+			idx := lo + (hi-lo)*k/(s.Parallel+1)
+			if idx <= lo || idx >= hi || tried[idx] {
+				continue
+			}
+			launch(idx)
+		}
+		if len(inflight) == 0 && lo+1 < hi {
+			if mid := (lo + hi) / 2; !tried[mid] {
+				launch(mid)
+			} else if cand, found := nextUntried(mid); found {
+				launch(cand)
+			}
+		}
+	}
+
+	cancelOutside := func() {
+		for idx, cancel := range inflight {
+			if idx <= lo || idx >= hi {
+				cancel()
+				delete(inflight, idx)
+			}
+		}
+	}
+
+	defer func() {
+		for _, cancel := range inflight {
+			cancel()
+		}
+	}()
+
+	refill()
+	for lo+1 < hi && len(inflight) > 0 {
+		var r probeOutcome
+		select {
+		case r = <-results:
+		case <-ctx.Done():
+			return 0, 0, Bad, Bad, false, ctx.Err()
+		}
+		delete(inflight, r.idx)
+		switch {
+		case r.err != nil:
+			return 0, 0, Bad, Bad, false, r.err
+		case r.idx <= lo || r.idx >= hi:
+			// A stale result for a point the interval has already passed.
+		case r.status == Skip:
+			s.logf("Value %d is SKIP; expanding search nearby", r.idx)
+			if cand, found := nextUntried(r.idx); found {
+				launch(cand)
+			}
+		case r.status == loOK:
+			lo, loOK = r.idx, r.status
+		default:
+			hi, hiOK = r.idx, r.status
+		}
+		cancelOutside()
+		refill()
+	}
+	if lo+1 < hi {
+		s.logf("Cannot narrow further: every reachable point in (%d, %d) is SKIP", lo, hi)
+		return lo, hi, loOK, hiOK, true, nil
+	}
+	return lo, hi, loOK, hiOK, false, nil
+}
+
+// probeNearby probes at mid, expanding outward by ±1, ±2, … within the open
+// interval (lo, hi) until it finds a point that is not Skip. It reports the
+// probed point and its status, or found=false if every point in (lo, hi)
+// is Skip.
+func (s *Searcher) probeNearby(ctx context.Context, lo, hi, mid int, np *int) (cand int, ok Status, found bool, err error) {
+	for d := 0; ; d++ {
+		cands := []int{mid - d, mid + d}
+		if d == 0 {
+			cands = cands[:1]
+		}
+		tried := false
+		for _, c := range cands {
+			if c <= lo || c >= hi {
+				continue
+			}
+			tried = true
+			*np++
+			st, perr := s.Probe(ctx, c)
+			if perr != nil {
+				return 0, Bad, false, perr
+			}
+			if st != Skip {
+				return c, st, true, nil
+			}
+			s.logf("Value %d is SKIP; expanding search by ±%d", c, d+1)
+		}
+		if !tried {
+			return 0, Bad, false, nil
+		}
+	}
+}
+
+// findBracket searches upward from (base, baseOK) for a value whose status
+// differs from baseOK, doubling the step size after each probe, and returns
+// the resulting (lo, hi, loOK, hiOK) bracket.
+func (s *Searcher) findBracket(ctx context.Context, base int, baseOK Status, np *int) (lo, hi int, loOK, hiOK Status, err error) {
+	loOK = baseOK
+	s.logf("Searching for a bracketing value above %d [%v]...", base, loOK)
+	delta := clog2(base)
+	cur := base
+	for {
+		next := base + delta
+		if next <= 0 { // overflow
+			return 0, 0, Bad, Bad, fmt.Errorf("no bracketing value found above lo=%d [%s]", base, loOK)
+		} else if s.MaxBracket > 0 && next > s.MaxBracket {
+			return 0, 0, Bad, Bad, fmt.Errorf("no bracketing value found between lo=%d [%s] and %d", base, loOK, s.MaxBracket)
+		}
+		*np++
+
+		s.logf("Bracketing search: base=%d [%s]; next=%d Δ=%d", cur, loOK, next, delta)
+		ok, perr := s.Probe(ctx, next)
+		if perr != nil {
+			return 0, 0, Bad, Bad, perr
+		}
+		switch {
+		case ok == Skip:
+			s.logf("Value %d is SKIP; continuing bracket search", next)
+		case ok != loOK:
+			lo, hi, hiOK = cur, next, ok
+			s.logf("Found bracketing value: hi=%d [%s], adjusted lo to %d", hi, hiOK, lo)
+			return lo, hi, loOK, hiOK, nil
+		default:
+			cur = next // next is a confirmed lower-bound probe
+		}
+		delta *= 2
+	}
+}
+
+func minmax(good, bad int) (lo, hi int, loOK, hiOK Status) {
+	if good > bad {
+		return bad, good, Bad, Good
+	}
+	return good, bad, Good, Bad
+}
+
+// clog2 returns the least k > 0 such that 2^k ≥ z.
+func clog2(z int) int {
+	k, n := 1, 2
+	for n < z {
+		k++
+		n *= 2
+	}
+	return k
+}
@@ -5,6 +5,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"io"
@@ -15,11 +16,13 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/creachadair/culprit/bisect"
 )
 
 var (
-	goodVal  = flag.Int("good", 0, "Value known to be good (0 to bracket)")
-	badVal   = flag.Int("bad", 0, "Value known to be bad (0 to bracket)")
+	goodVal  = flag.String("good", "", "Value or revision known to be good (empty to bracket)")
+	badVal   = flag.String("bad", "", "Value or revision known to be bad (empty to bracket)")
 	doBrack  = flag.Bool("bracket", false, "Enable bracketing")
 	doEcho   = flag.Bool("echo", false, "Echo probe command output to stderr")
 	doLog    = flag.Bool("log", false, "Log probe commands as executed to stderr")
@@ -28,6 +31,9 @@ var (
 	clMarker = flag.String("env", "PROBE", "Variable with probe value in script environment")
 	inShell  = flag.String("shell", "/bin/sh", "Shell to use for running scripts")
 	maxBrack = flag.Int("bmax", 0, "Maximum bracketing value")
+	skipCode = flag.Int("skip", 125, "Exit code that marks a probe point as untestable (0 to disable)")
+	vcsMode  = flag.String("vcs", "", `VCS backend for resolving probe points (currently only "git")`)
+	parallel = flag.Int("parallel", 0, "Speculatively run this many probes in parallel (0 or 1 for serial)")
 
 	cmdOutput = io.Discard
 )
@@ -56,6 +62,19 @@ If -cd is set, the probe script is run with its current working directory set
 to the specified value. The variable $PROBE is replaced with the current probe
 value in the directory path.
 
+If a probe exits with the code given by -skip (125 by default, matching the
+convention used by "git bisect run"), the probe point is treated as
+untestable rather than BAD, and the search tries nearby points instead.
+
+If -vcs=git is given, -good and -bad name git revisions instead of integers,
+and the probe space is the first-parent history between them; see -worktree
+and -json.
+
+If -parallel is greater than 1, up to that many probes run speculatively at
+once, which can reduce wall-clock time when each probe is slow. -parallel is
+not supported together with -vcs=git, since concurrent probes would race
+over the single working tree's checkout.
+
 Options:
 `, filepath.Base(os.Args[0]))
 		flag.PrintDefaults()
@@ -71,124 +90,96 @@ func main() {
 		cmdOutput = os.Stderr
 	}
 
-	// Establish the endpoints of the search. These may be modified by
-	// bracketing (see below).
-	if *goodVal < 0 || *badVal < 0 {
-		log.Fatalf("The values of GOOD (%d) and BAD (%d) must be non-negative", *goodVal, *badVal)
-	} else if *goodVal == *badVal {
-		log.Fatalf("The values of GOOD and BAD must be distinct (got %d)", *goodVal)
+	ctx := context.Background()
+	s := &bisect.Searcher{
+		Verify:     *doVerify,
+		Bracket:    *doBrack,
+		MaxBracket: *maxBrack,
+		Parallel:   *parallel,
+		Log:        os.Stderr,
 	}
-	diag("Using %d as GOOD, using %d as BAD", *goodVal, *badVal)
-
-	// Order the endpoints so that lo ≤ hi.  If requested, verify that the
-	// starting endpoints have the expected status.
-	lo, hi, loOK, hiOK := minmax(*goodVal, *badVal)
-	if *doVerify {
-		if lo > 0 {
-			diag("▷ Verifying that %d is %v...", lo, loOK)
-			if ok := runTrial(lo, flag.Args()); ok != loOK {
-				log.Fatalf("Value %d reports as %v, but is expected to be %v", lo, ok, loOK)
-			}
+
+	switch *vcsMode {
+	case "":
+		s.Probe = probeScript(flag.Args())
+		result, err := s.Search(ctx, parseEndpoint(*goodVal), parseEndpoint(*badVal))
+		if err != nil {
+			log.Fatal(err)
 		}
-		diag("▷ Verifying that %d is %v...", hi, hiOK)
-		if ok := runTrial(hi, flag.Args()); ok != hiOK {
-			log.Fatalf("Value %d reports as %v, but is expected to be %v", hi, ok, hiOK)
+		reportResult(result)
+	case "git":
+		if *goodVal == "" || *badVal == "" {
+			log.Fatal("-vcs=git requires both -good and -bad to name revisions")
 		}
+		runGit(ctx, s, *goodVal, *badVal)
+	default:
+		log.Fatalf("unknown -vcs %q", *vcsMode)
 	}
+}
 
-	// Search for a culprit...
-	np := 0 // probe counter
-	start := time.Now()
-
-	// Bracketing: If lo == 0, search for a bracketing value above hi.
-	if *doBrack && lo == 0 {
-		// Use hi as the baseline.
-		lo, loOK = hi, hiOK
-
-		diag("Searching for a bracketing value above %d [%v]...", lo, loOK)
-		delta := clog2(lo)
-		base := lo
-		for {
-			next := lo + delta
-			if next <= 0 { // overflow
-				log.Fatalf("No bracketing value found above lo=%d [%s]", lo, loOK)
-			} else if *maxBrack > 0 && next > *maxBrack {
-				log.Fatalf("No bracketing value found between lo=%d [%s] and %d", lo, loOK, *maxBrack)
-			}
-			np++
-
-			// If the search brackets a change, we're done.
-			diag("Bracketing search: base=%d [%s]; next=%d Δ=%d", base, loOK, next, delta)
-			if runTrial(next, flag.Args()) != loOK {
-				hi = next
-				hiOK = !loOK
-				lo = base
-				break
-			}
-			delta *= 2
-			base = next
-		}
-		diag("Found bracketing value: hi=%d [%s], adjusted lo to %d", hi, hiOK, lo)
+// parseEndpoint parses s as an integer probe value, where an empty string
+// means "bracket from the other endpoint".
+func parseEndpoint(s string) int {
+	if s == "" {
+		return 0
 	}
-
-	// Binary search in the remaining delta.
-	for lo+1 < hi {
-		next := (lo + hi) / 2
-		np++
-		diag("Current state: lo=%d [%s] hi=%d [%s]; next=%d Δ=%d", lo, loOK, hi, hiOK, next, hi-lo)
-		ok := runTrial(next, flag.Args())
-		if ok == loOK {
-			lo = next
-			loOK = ok
-		} else {
-			hi = next
-			hiOK = ok
-		}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		log.Fatalf("invalid value %q for -good/-bad: %v", s, err)
 	}
+	return n
+}
 
-	// Report on the outcome.
-	if lo < hi {
-		printCulpritInfo(lo, loOK, hi, hiOK)
+func reportResult(result *bisect.Result) {
+	if result.Indeterminate {
+		fmt.Printf("▷ Cannot narrow further: %d..%d is entirely untestable\n", result.Lo, result.Hi)
+	} else if result.Found() {
+		printCulpritInfo(result.Lo, result.LoOK, result.Hi, result.HiOK)
 	} else {
 		fmt.Println("No culprit found")
 	}
-	diag("%d probes; total time elapsed: %v", np, time.Since(start))
+	diag("%d probes; total time elapsed: %v", result.Probes, result.Elapsed)
 }
 
 func diag(msg string, args ...interface{}) { fmt.Fprintf(os.Stderr, msg+"\n", args...) }
 
-type status bool
-
-// Status markers.
-const (
-	GOOD status = true
-	BAD  status = false
-)
-
-func (s status) String() string {
-	if s == GOOD {
-		return "GOOD"
-	}
-	return "BAD"
-}
-
-func (s status) Mark() rune {
-	if s == GOOD {
-		return '✓'
+// probeScript returns a bisect.Probe that runs args as a shell script,
+// reporting GOOD if it exits successfully, SKIP if it exits with the code
+// named by -skip, and BAD otherwise.
+func probeScript(args []string) bisect.Probe {
+	return func(ctx context.Context, cl int) (bisect.Status, error) {
+		start := time.Now()
+		cmd := prepCommand(ctx, args, cl)
+		err := cmd.Run()
+		out := bisect.Good
+		if err != nil {
+			if e, ok := err.(*exec.ExitError); ok {
+				if *skipCode > 0 && e.ExitCode() == *skipCode {
+					out = bisect.Skip
+				} else {
+					out = bisect.Bad
+				}
+			} else {
+				return bisect.Bad, fmt.Errorf("subprocess failed: %w", err)
+			}
+		}
+		diag(" %c %d is %v\t[%v elapsed]", out.Mark(), cl, out, time.Since(start))
+		return out, nil
 	}
-	return '✗'
 }
 
-func prepCommand(args []string, cl int) *exec.Cmd {
+func prepCommand(ctx context.Context, args []string, cl int, extraEnv ...string) *exec.Cmd {
 	script := strings.Join(args, " ")
 	logCommand("SCRIPT", script, nil)
-	cmd := exec.Command(*inShell)
+	cmd := exec.CommandContext(ctx, *inShell)
 	cmd.Stdin = strings.NewReader(script)
 	cmd.Stdout = cmdOutput
 	cmd.Stderr = cmdOutput
+	cmd.Env = os.Environ()
 	if *clMarker != "" {
-		cmd.Env = append(os.Environ(), fmt.Sprintf("%s=%d", *clMarker, cl))
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%d", *clMarker, cl))
 	}
+	cmd.Env = append(cmd.Env, extraEnv...)
 	if *doChdir != "" {
 		cmd.Dir = os.Expand(*doChdir, func(key string) string {
 			if key == "PROBE" {
@@ -207,43 +198,9 @@ func logCommand(tag, cmd string, args []string) {
 	}
 }
 
-func runTrial(cl int, args []string) (out status) {
-	start := time.Now()
-	defer func() {
-		diag(" %c %d is %v\t[%v elapsed]", out.Mark(), cl, out, time.Since(start))
-	}()
-
-	if err := prepCommand(args, cl).Run(); err != nil {
-		if e, ok := err.(*exec.ExitError); ok {
-			return status(e.Success())
-		}
-		log.Fatalf("Subprocess failed: %v", err)
-	}
-	return GOOD
-}
-
-func minmax(good, bad int) (lo, hi int, loOK, hiOK status) {
-	if good > bad {
-		return bad, good, BAD, GOOD
-	}
-	return good, bad, GOOD, BAD
-}
-
-// clog2 returns the least k > 0 such that 2^k ≥ z.
-func clog2(z int) int {
-	k, n := 1, 2
-	for n < z {
-		k++
-		n *= 2
-	}
-	return k
-}
-
-func printCulpritInfo(lo int, loOK status, hi int, hiOK status) {
+func printCulpritInfo(lo int, loOK bisect.Status, hi int, hiOK bisect.Status) {
 	fmt.Printf(`▷ Culprit found:
   Before: %d [%s]
   After:  %d [%s]
 `, lo, loOK, hi, hiOK)
-
-	// TODO: Add support for printing git logs, since that is a common use case.
 }
@@ -0,0 +1,137 @@
+// Copyright (C) 2018 Michael J. Fromberger. All Rights Reserved.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/creachadair/culprit/bisect"
+	"github.com/creachadair/culprit/vcs"
+)
+
+var (
+	useWorktree = flag.String("worktree", "", "Check out revisions in this worktree directory rather than the current one (requires -vcs=git)")
+	doJSON      = flag.Bool("json", false, "Emit the -vcs=git result as JSON instead of text")
+)
+
+// runGit implements -vcs=git: good and bad name git revisions rather than
+// integers, and the probe space is the first-parent history between them.
+func runGit(ctx context.Context, s *bisect.Searcher, good, bad string) {
+	if s.Parallel > 1 {
+		log.Fatal("-parallel is not supported together with -vcs=git: concurrent probes would race over the single working tree's checkout")
+	}
+	// Both endpoints name real commits, so there is nothing to bracket.
+	s.Bracket = false
+	repo := &vcs.Git{Dir: "."}
+	shas, err := repo.Commits(ctx, good, bad)
+	if err != nil {
+		log.Fatal(err)
+	}
+	diag("Resolved %d commits between %s and %s", len(shas), good, bad)
+
+	probeRepo := repo
+	if *useWorktree != "" {
+		wt, cleanup, err := repo.NewWorktree(ctx, *useWorktree)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer cleanup()
+		probeRepo = wt
+	}
+
+	s.Probe = gitProbe(probeRepo, shas, flag.Args())
+	result, err := s.Search(ctx, 0, len(shas)-1)
+	if err != nil {
+		log.Fatal(err)
+	}
+	reportGit(repo, shas, result)
+}
+
+// gitProbe returns a bisect.Probe that checks out shas[n] in repo and runs
+// args as a shell script, exporting PROBE_SHA alongside PROBE.
+func gitProbe(repo *vcs.Git, shas []string, args []string) bisect.Probe {
+	return func(ctx context.Context, n int) (bisect.Status, error) {
+		start := time.Now()
+		if err := repo.Checkout(ctx, shas[n]); err != nil {
+			return bisect.Bad, err
+		}
+		cmd := prepCommand(ctx, args, n, "PROBE_SHA="+shas[n])
+		cmd.Dir = repo.Dir
+		err := cmd.Run()
+		out := bisect.Good
+		if err != nil {
+			if e, ok := err.(*exec.ExitError); ok {
+				if *skipCode > 0 && e.ExitCode() == *skipCode {
+					out = bisect.Skip
+				} else {
+					out = bisect.Bad
+				}
+			} else {
+				return bisect.Bad, fmt.Errorf("subprocess failed: %w", err)
+			}
+		}
+		diag(" %c %s is %v\t[%v elapsed]", out.Mark(), shas[n], out, time.Since(start))
+		return out, nil
+	}
+}
+
+// gitReport is the -json representation of a completed -vcs=git search.
+type gitReport struct {
+	Before        string `json:"before"`
+	After         string `json:"after"`
+	Probes        int    `json:"probes"`
+	Elapsed       string `json:"elapsed"`
+	Indeterminate bool   `json:"indeterminate,omitempty"`
+}
+
+func reportGit(repo *vcs.Git, shas []string, result *bisect.Result) {
+	if result.Indeterminate {
+		if *doJSON {
+			emitJSON(gitReport{Before: shas[result.Lo], After: shas[result.Hi], Probes: result.Probes, Elapsed: result.Elapsed.String(), Indeterminate: true})
+		} else {
+			fmt.Printf("▷ Cannot narrow further: %s..%s is entirely untestable\n", shas[result.Lo], shas[result.Hi])
+		}
+		diag("%d probes; total time elapsed: %v", result.Probes, result.Elapsed)
+		return
+	}
+	if !result.Found() {
+		fmt.Println("No culprit found")
+		diag("%d probes; total time elapsed: %v", result.Probes, result.Elapsed)
+		return
+	}
+
+	before, after := shas[result.Lo], shas[result.Hi]
+	if *doJSON {
+		emitJSON(gitReport{Before: before, After: after, Probes: result.Probes, Elapsed: result.Elapsed.String()})
+		diag("%d probes; total time elapsed: %v", result.Probes, result.Elapsed)
+		return
+	}
+
+	fmt.Println("▷ Culprit found:")
+	printLogStat(repo, "Before", before)
+	printLogStat(repo, "After", after)
+	diag("%d probes; total time elapsed: %v", result.Probes, result.Elapsed)
+}
+
+func printLogStat(repo *vcs.Git, label, rev string) {
+	out, err := repo.LogStat(context.Background(), rev)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("== %s: %s ==\n%s\n", label, rev, out)
+}
+
+func emitJSON(v interface{}) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		log.Fatal(err)
+	}
+}
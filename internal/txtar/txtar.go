@@ -0,0 +1,91 @@
+// Copyright (C) 2018 Michael J. Fromberger. All Rights Reserved.
+
+// Package txtar implements a trivial text-based file archive format, used
+// by the script test harness to bundle a test script together with the
+// fixture files it needs.
+//
+// The format is:
+//
+//	comment
+//	-- first file name --
+//	file content
+//	-- second file name --
+//	file content
+//
+// The file begins with a free-form comment, terminated by a line beginning
+// with the marker "-- " and ending with " --". Each subsequent such line
+// begins a new file whose content runs to the next marker line or the end
+// of the archive.
+package txtar
+
+import (
+	"bytes"
+	"strings"
+)
+
+// A File is a single file in an Archive.
+type File struct {
+	Name string
+	Data []byte
+}
+
+// An Archive is a collection of files, along with a comment that precedes
+// the first file marker.
+type Archive struct {
+	Comment []byte
+	Files   []File
+}
+
+// Parse parses data as a txtar archive.
+func Parse(data []byte) *Archive {
+	a := new(Archive)
+	var name string
+	a.Comment, name, data = findFileMarker(data)
+	for name != "" {
+		f := File{Name: name}
+		f.Data, name, data = findFileMarker(data)
+		a.Files = append(a.Files, f)
+	}
+	return a
+}
+
+var (
+	marker    = []byte("-- ")
+	markerEnd = []byte(" --")
+)
+
+// findFileMarker scans data for the next file marker line, returning the
+// content preceding it, the name of the file it introduces (or "" if none
+// was found), and the data following the marker line.
+func findFileMarker(data []byte) (before []byte, name string, after []byte) {
+	var i int
+	for {
+		if name, after = isMarker(data[i:]); name != "" {
+			return data[:i], name, after
+		}
+		j := bytes.IndexByte(data[i:], '\n')
+		if j < 0 {
+			return data, "", nil
+		}
+		i += j + 1
+	}
+}
+
+// isMarker reports whether data begins with a file marker line, and if so
+// returns the file name it names and the data following that line.
+func isMarker(data []byte) (name string, after []byte) {
+	if !bytes.HasPrefix(data, marker) {
+		return "", nil
+	}
+	var line []byte
+	if j := bytes.IndexByte(data, '\n'); j < 0 {
+		line, after = data, nil
+	} else {
+		line, after = data[:j], data[j+1:]
+	}
+	line = bytes.TrimRight(line, " \t")
+	if !bytes.HasSuffix(line, markerEnd) || len(line) < len(marker)+len(markerEnd) {
+		return "", nil
+	}
+	return strings.TrimSpace(string(line[len(marker) : len(line)-len(markerEnd)])), after
+}
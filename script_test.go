@@ -0,0 +1,319 @@
+// Copyright (C) 2018 Michael J. Fromberger. All Rights Reserved.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/creachadair/culprit/internal/txtar"
+)
+
+// TestScript runs the end-to-end test scripts under testdata/script as
+// subtests. Each script is a txtar archive whose comment holds a sequence
+// of test commands and whose files are materialized into a scratch
+// directory before the commands run.
+//
+// Recognized commands (one per line; blank lines and lines starting with #
+// are ignored; a leading "!" negates the exit status check):
+//
+//	mkprobe threshold=N [reverse=true] [skip=V,...] [envcheck=NAME=VALUE]
+//	    Sets the probe script used by subsequent "culprit" commands. The
+//	    probe reports GOOD for values below threshold (or at/above it, with
+//	    reverse=true), SKIP for values listed in skip, and may additionally
+//	    require an environment variable to hold a given value.
+//	mkdirs N
+//	    Creates directories "0" through "N" in the scratch directory.
+//	gitinit N
+//	    Creates a git repository in the scratch directory with commits
+//	    "0" through "N", tagged "c0" through "cN".
+//	env NAME=VALUE
+//	    Adds NAME=VALUE to the environment of subsequent "culprit" commands.
+//	culprit ARGS...
+//	    Runs the culprit binary with ARGS plus the current probe script,
+//	    recording its stdout and stderr.
+//	cmp stdout|stderr FILE
+//	    Compares the named output of the last "culprit" command against the
+//	    content of FILE, an archive file, for an exact match.
+//	stdout|stderr TEXT
+//	    Checks that the named output of the last "culprit" command contains
+//	    TEXT.
+func TestScript(t *testing.T) {
+	bin := buildCulprit(t)
+
+	paths, err := filepath.Glob("testdata/script/*.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("no test scripts found")
+	}
+	for _, path := range paths {
+		path := path
+		t.Run(strings.TrimSuffix(filepath.Base(path), ".txt"), func(t *testing.T) {
+			runScript(t, bin, path)
+		})
+	}
+}
+
+// buildCulprit compiles the culprit binary once for use by all the scripts.
+func buildCulprit(t *testing.T) string {
+	t.Helper()
+	bin := filepath.Join(t.TempDir(), "culprit")
+	cmd := exec.Command("go", "build", "-o", bin, ".")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("building culprit: %v\n%s", err, out)
+	}
+	return bin
+}
+
+func runScript(t *testing.T, bin, path string) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ar := txtar.Parse(data)
+
+	dir := t.TempDir()
+	for _, f := range ar.Files {
+		fp := filepath.Join(dir, f.Name)
+		if err := os.MkdirAll(filepath.Dir(fp), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fp, f.Data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	e := &scriptEnv{t: t, bin: bin, dir: dir}
+	for _, line := range strings.Split(string(ar.Comment), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		e.exec(line)
+	}
+}
+
+// scriptEnv holds the state of a single script as it executes.
+type scriptEnv struct {
+	t   *testing.T
+	bin string
+	dir string
+
+	probe    string   // probe script generated by the most recent mkprobe
+	extraEnv []string // environment added by "env" commands
+
+	stdout, stderr string // output of the most recent culprit invocation
+}
+
+func (e *scriptEnv) exec(line string) {
+	e.t.Helper()
+	wantFail := false
+	if strings.HasPrefix(line, "!") {
+		wantFail = true
+		line = strings.TrimSpace(line[1:])
+	}
+	args := splitWords(line)
+	if len(args) == 0 {
+		return
+	}
+	switch args[0] {
+	case "mkprobe":
+		e.mkprobe(args[1:])
+	case "mkdirs":
+		e.mkdirs(args[1:])
+	case "gitinit":
+		e.gitinit(args[1:])
+	case "env":
+		e.extraEnv = append(e.extraEnv, args[1:]...)
+	case "culprit":
+		e.culprit(args[1:], wantFail)
+	case "cmp":
+		e.cmp(args[1:])
+	case "stdout":
+		e.contains(e.stdout, "stdout", args[1:])
+	case "stderr":
+		e.contains(e.stderr, "stderr", args[1:])
+	default:
+		e.t.Fatalf("unknown script command %q", args[0])
+	}
+}
+
+func (e *scriptEnv) mkprobe(args []string) {
+	e.t.Helper()
+	opts := parseKV(args)
+	threshold, err := strconv.Atoi(opts["threshold"])
+	if err != nil {
+		e.t.Fatalf("mkprobe: bad threshold: %v", err)
+	}
+	op := "-lt"
+	if opts["reverse"] == "true" {
+		op = "-ge"
+	}
+
+	var b strings.Builder
+	for _, v := range strings.Split(opts["skip"], ",") {
+		if v != "" {
+			fmt.Fprintf(&b, `[ "$PROBE" = %q ] && exit 125; `, v)
+		}
+	}
+	if ec := opts["envcheck"]; ec != "" {
+		name, value, _ := strings.Cut(ec, "=")
+		fmt.Fprintf(&b, `[ "$%s" = %q ] || exit 1; `, name, value)
+	}
+	fmt.Fprintf(&b, `test "$PROBE" %s %d`, op, threshold)
+	e.probe = b.String()
+}
+
+func (e *scriptEnv) mkdirs(args []string) {
+	e.t.Helper()
+	if len(args) != 1 {
+		e.t.Fatal("mkdirs: want exactly one argument")
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil {
+		e.t.Fatalf("mkdirs: %v", err)
+	}
+	for i := 0; i <= n; i++ {
+		if err := os.Mkdir(filepath.Join(e.dir, strconv.Itoa(i)), 0o755); err != nil {
+			e.t.Fatal(err)
+		}
+	}
+}
+
+// gitinit creates a git repository in the scratch directory with n+1
+// commits, each adding a file and tagging the result "c0" through "cn", for
+// use by scripts that exercise -vcs=git.
+func (e *scriptEnv) gitinit(args []string) {
+	e.t.Helper()
+	if len(args) != 1 {
+		e.t.Fatal("gitinit: want exactly one argument")
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil {
+		e.t.Fatalf("gitinit: %v", err)
+	}
+	env := append(os.Environ(),
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+	)
+	git := func(args ...string) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = e.dir
+		cmd.Env = env
+		if out, err := cmd.CombinedOutput(); err != nil {
+			e.t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	git("init", "--quiet", "-b", "main")
+	for i := 0; i <= n; i++ {
+		name := fmt.Sprintf("%d.txt", i)
+		if err := os.WriteFile(filepath.Join(e.dir, name), []byte(strconv.Itoa(i)), 0o644); err != nil {
+			e.t.Fatal(err)
+		}
+		git("add", name)
+		git("commit", "--quiet", "-m", fmt.Sprintf("commit %d", i))
+		git("tag", fmt.Sprintf("c%d", i))
+	}
+}
+
+func (e *scriptEnv) culprit(args []string, wantFail bool) {
+	e.t.Helper()
+	full := append([]string{}, args...)
+	if e.probe != "" {
+		full = append(full, e.probe)
+	}
+	cmd := exec.Command(e.bin, full...)
+	cmd.Dir = e.dir
+	if len(e.extraEnv) > 0 {
+		cmd.Env = append(os.Environ(), e.extraEnv...)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+	e.stdout, e.stderr = stdout.String(), stderr.String()
+
+	if wantFail && err == nil {
+		e.t.Fatalf("culprit %v: expected failure, got success\nstdout: %s\nstderr: %s", args, e.stdout, e.stderr)
+	} else if !wantFail && err != nil {
+		e.t.Fatalf("culprit %v: %v\nstdout: %s\nstderr: %s", args, err, e.stdout, e.stderr)
+	}
+}
+
+func (e *scriptEnv) cmp(args []string) {
+	e.t.Helper()
+	if len(args) != 2 {
+		e.t.Fatal("cmp: want exactly two arguments")
+	}
+	var got string
+	switch args[0] {
+	case "stdout":
+		got = e.stdout
+	case "stderr":
+		got = e.stderr
+	default:
+		e.t.Fatalf("cmp: unknown source %q", args[0])
+	}
+	want, err := os.ReadFile(filepath.Join(e.dir, args[1]))
+	if err != nil {
+		e.t.Fatalf("cmp: %v", err)
+	}
+	if got != string(want) {
+		e.t.Errorf("cmp %s: got:\n%s\nwant:\n%s", args[0], got, want)
+	}
+}
+
+func (e *scriptEnv) contains(got, label string, args []string) {
+	e.t.Helper()
+	if len(args) != 1 {
+		e.t.Fatalf("%s: want exactly one argument", label)
+	}
+	if !strings.Contains(got, args[0]) {
+		e.t.Errorf("%s does not contain %q; got:\n%s", label, args[0], got)
+	}
+}
+
+// splitWords splits s on spaces, treating text enclosed in single quotes as
+// a single word.
+func splitWords(s string) []string {
+	var words []string
+	var cur strings.Builder
+	inQuote := false
+	flush := func() {
+		if cur.Len() > 0 {
+			words = append(words, cur.String())
+			cur.Reset()
+		}
+	}
+	for _, r := range s {
+		switch {
+		case r == '\'':
+			inQuote = !inQuote
+		case r == ' ' && !inQuote:
+			flush()
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	flush()
+	return words
+}
+
+// parseKV parses a list of "key=value" arguments into a map.
+func parseKV(args []string) map[string]string {
+	m := make(map[string]string)
+	for _, a := range args {
+		if name, value, ok := strings.Cut(a, "="); ok {
+			m[name] = value
+		}
+	}
+	return m
+}
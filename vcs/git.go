@@ -0,0 +1,84 @@
+// Copyright (C) 2018 Michael J. Fromberger. All Rights Reserved.
+
+// Package vcs provides version-control backends that resolve a range of
+// revisions into an ordered probe space for the bisect package, and check
+// out individual revisions on demand.
+package vcs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Git resolves and checks out revisions in a git working tree or worktree.
+type Git struct {
+	// Dir is the working tree to operate in.
+	Dir string
+}
+
+// Commits resolves good and bad to commit SHAs and returns the ordered
+// sequence of commits along the first-parent history between them, from
+// good (inclusive, at index 0) to bad (inclusive, at the last index).
+func (g *Git) Commits(ctx context.Context, good, bad string) ([]string, error) {
+	goodSHA, err := g.revParse(ctx, good)
+	if err != nil {
+		return nil, err
+	}
+	badSHA, err := g.revParse(ctx, bad)
+	if err != nil {
+		return nil, err
+	}
+	out, err := g.run(ctx, "rev-list", "--first-parent", "--reverse", goodSHA+".."+badSHA)
+	if err != nil {
+		return nil, err
+	}
+	shas := append([]string{goodSHA}, strings.Fields(out)...)
+	if shas[len(shas)-1] != badSHA {
+		return nil, fmt.Errorf("%s is not a first-parent descendant of %s", bad, good)
+	}
+	return shas, nil
+}
+
+// Checkout checks out sha in the working tree.
+func (g *Git) Checkout(ctx context.Context, sha string) error {
+	_, err := g.run(ctx, "checkout", "--quiet", sha)
+	return err
+}
+
+// LogStat returns the output of "git log -1 --stat" for rev.
+func (g *Git) LogStat(ctx context.Context, rev string) (string, error) {
+	return g.run(ctx, "log", "-1", "--stat", rev)
+}
+
+// NewWorktree creates a git worktree at dir, detached at HEAD, and returns a
+// Git backend rooted there along with a function that removes it.
+func (g *Git) NewWorktree(ctx context.Context, dir string) (*Git, func(), error) {
+	if _, err := g.run(ctx, "worktree", "add", "--quiet", "--detach", dir); err != nil {
+		return nil, nil, err
+	}
+	wt := &Git{Dir: dir}
+	cleanup := func() { g.run(ctx, "worktree", "remove", "--force", dir) }
+	return wt, cleanup, nil
+}
+
+func (g *Git) revParse(ctx context.Context, rev string) (string, error) {
+	out, err := g.run(ctx, "rev-parse", "--verify", rev)
+	if err != nil {
+		return "", fmt.Errorf("resolving %q: %w", rev, err)
+	}
+	return strings.TrimSpace(out), nil
+}
+
+func (g *Git) run(ctx context.Context, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = g.Dir
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}